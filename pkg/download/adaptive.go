@@ -0,0 +1,152 @@
+package download
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Bounds and target for chooseSegmentSize's adaptive sizing.
+const (
+	minAdaptiveSegmentSize = 256 * 1024       // 256 KiB
+	maxAdaptiveSegmentSize = 16 * 1024 * 1024 // 16 MiB
+	initialSegmentSize     = 1024 * 1024      // 1 MiB
+	probeRangeSize         = 256 * 1024
+	targetSegmentDuration  = 3 * time.Second // aim for ~2-5s of transfer per segment
+)
+
+// chooseSegmentSize picks a segment size for a fresh download of length
+// bytes from url, starting from a 1 MiB default and scaling it toward
+// whatever size would take targetSegmentDuration to transfer at the
+// throughput observed from a short probe request. The result is clamped to
+// [minAdaptiveSegmentSize, maxAdaptiveSegmentSize] and to whatever size
+// keeps the file's segment count under maxSegments.
+func chooseSegmentSize(client *http.Client, url string, length int64) int64 {
+	size := int64(initialSegmentSize)
+
+	if length > probeRangeSize {
+		if throughput, ok := probeThroughput(client, url); ok && throughput > 0 {
+			size = int64(throughput * targetSegmentDuration.Seconds())
+		}
+	}
+
+	if size < minAdaptiveSegmentSize {
+		size = minAdaptiveSegmentSize
+	}
+	if size > maxAdaptiveSegmentSize {
+		size = maxAdaptiveSegmentSize
+	}
+	if minForCap := (length + maxSegments - 1) / maxSegments; size < minForCap {
+		size = minForCap
+	}
+	if size > length {
+		size = length
+	}
+
+	return size
+}
+
+// gridSegmentSize returns the progress file's resume-grid cell size for a
+// fresh adaptive download of length bytes: the smallest size that's still
+// at least minAdaptiveSegmentSize, bumped up only as far as keeping the
+// file's segment count under maxSegments requires. SegmentedFileMode
+// dispatches jobs spanning one or more of these cells, sized by
+// adaptiveSegmentSizer; keeping the cells themselves small leaves that
+// sizer room to shrink a job all the way back down to a single cell
+// instead of being stuck at whatever size the initial probe picked.
+func gridSegmentSize(length int64) int64 {
+	size := int64(minAdaptiveSegmentSize)
+	if minForCap := (length + maxSegments - 1) / maxSegments; size < minForCap {
+		size = minForCap
+	}
+	if size > length {
+		size = length
+	}
+	return size
+}
+
+// clampSegmentSize bounds size to [minAdaptiveSegmentSize, maxAdaptiveSegmentSize].
+func clampSegmentSize(size int64) int64 {
+	if size < minAdaptiveSegmentSize {
+		return minAdaptiveSegmentSize
+	}
+	if size > maxAdaptiveSegmentSize {
+		return maxAdaptiveSegmentSize
+	}
+	return size
+}
+
+// adaptiveSegmentSizer tracks the throughput actually observed for a
+// download as segments complete, growing or shrinking the size dispatched
+// for the next job to keep pace with targetSegmentDuration. It replaces
+// chooseSegmentSize's one-shot probe with a size that keeps adjusting for
+// the life of the transfer; a SegmentedFileMode shares one sizer across all
+// of its workers, so every success or failure updates the same estimate.
+type adaptiveSegmentSizer struct {
+	mu   sync.Mutex
+	size int64
+}
+
+// newAdaptiveSegmentSizer returns a sizer seeded at initial, typically the
+// size chooseSegmentSize picked for the download's first job.
+func newAdaptiveSegmentSizer(initial int64) *adaptiveSegmentSizer {
+	return &adaptiveSegmentSizer{size: clampSegmentSize(initial)}
+}
+
+// next returns the size to dispatch for the next job.
+func (a *adaptiveSegmentSizer) next() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.size
+}
+
+// record updates the target size from a job that transferred bytes over
+// elapsed, smoothing halfway toward whatever size would take
+// targetSegmentDuration at that throughput.
+func (a *adaptiveSegmentSizer) record(bytes int64, elapsed time.Duration) {
+	if bytes <= 0 || elapsed <= 0 {
+		return
+	}
+	throughput := float64(bytes) / elapsed.Seconds()
+	target := clampSegmentSize(int64(throughput * targetSegmentDuration.Seconds()))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.size = (a.size + target) / 2
+}
+
+// shrink halves the target size after a failed job, on the assumption that
+// a smaller range is more likely to complete before a flaky connection
+// drops it.
+func (a *adaptiveSegmentSizer) shrink() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.size = clampSegmentSize(a.size / 2)
+}
+
+// probeThroughput times a short range request against url and returns the
+// observed bytes/sec, or ok=false if the probe failed.
+func probeThroughput(client *http.Client, url string) (bytesPerSec float64, ok bool) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return 0, false
+	}
+	req.Header.Add("Range", fmt.Sprintf("bytes=0-%d", probeRangeSize-1))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil || (resp.StatusCode != 206 && resp.StatusCode != 200) {
+		return 0, false
+	}
+	defer resp.Body.Close()
+
+	n, err := io.Copy(io.Discard, resp.Body)
+	elapsed := time.Since(start)
+	if err != nil || elapsed <= 0 || n == 0 {
+		return 0, false
+	}
+
+	return float64(n) / elapsed.Seconds(), true
+}
@@ -0,0 +1,100 @@
+package download
+
+import (
+	"net/http"
+	"testing"
+)
+
+func headerWith(key, value string) http.Header {
+	h := http.Header{}
+	h.Set(key, value)
+	return h
+}
+
+func TestExtractContentHash(t *testing.T) {
+	cases := []struct {
+		name      string
+		header    http.Header
+		wantAlgo  string
+		wantFound bool
+	}{
+		{
+			name:      "x-goog-hash md5",
+			header:    http.Header{"X-Goog-Hash": {"crc32c=AAAAAA==,md5=XUFAKrxLKna5cZ2REBfFkg=="}},
+			wantAlgo:  "md5",
+			wantFound: true,
+		},
+		{
+			name:      "digest sha-256",
+			header:    http.Header{"Digest": {"SHA-256=LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564="}},
+			wantAlgo:  "sha256",
+			wantFound: true,
+		},
+		{
+			name:      "digest md5",
+			header:    http.Header{"Digest": {"md5=XUFAKrxLKna5cZ2REBfFkg=="}},
+			wantAlgo:  "md5",
+			wantFound: true,
+		},
+		{
+			name:      "digest unrecognized algorithm is ignored",
+			header:    http.Header{"Digest": {"sha-512=" + string(make([]byte, 512))}},
+			wantAlgo:  "",
+			wantFound: false,
+		},
+		{
+			name:      "digest falls through to a recognized entry",
+			header:    http.Header{"Digest": {"unknown=bm90IGEgcmVhbCBoYXNo, md5=XUFAKrxLKna5cZ2REBfFkg=="}},
+			wantAlgo:  "md5",
+			wantFound: true,
+		},
+		{
+			name:      "content-md5",
+			header:    headerWith("Content-MD5", "XUFAKrxLKna5cZ2REBfFkg=="),
+			wantAlgo:  "md5",
+			wantFound: true,
+		},
+		{
+			name:      "bare md5 etag",
+			header:    headerWith("ETag", `"5d41402abc4b2a76b9719d911017c592"`),
+			wantAlgo:  "md5",
+			wantFound: true,
+		},
+		{
+			name:      "weak etag of the wrong length is ignored",
+			header:    headerWith("ETag", `"abc123"`),
+			wantAlgo:  "",
+			wantFound: false,
+		},
+		{
+			name:      "no recognized headers",
+			header:    http.Header{},
+			wantAlgo:  "",
+			wantFound: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			algo, hash := extractContentHash(c.header)
+			if (algo != "") != c.wantFound || algo != c.wantAlgo {
+				t.Fatalf("extractContentHash() = (%q, %q), want algorithm %q (found=%v)", algo, hash, c.wantAlgo, c.wantFound)
+			}
+			if c.wantFound && hash == "" {
+				t.Fatalf("extractContentHash() returned an empty hash alongside algorithm %q", algo)
+			}
+		})
+	}
+}
+
+func TestExtractContentHashNeverReturnsAnUnboundedAlgorithmName(t *testing.T) {
+	// A server advertising a long, unrecognized Digest algorithm must not
+	// have that name persisted into the progress file header: only the
+	// fixed "md5"/"sha256" strings this package knows how to verify are
+	// ever returned.
+	header := http.Header{"Digest": {"x-custom-algorithm-name=bm90IGEgcmVhbCBoYXNo"}}
+	algo, hash := extractContentHash(header)
+	if algo != "" || hash != "" {
+		t.Fatalf("extractContentHash() = (%q, %q), want (\"\", \"\") for an unrecognized algorithm", algo, hash)
+	}
+}
@@ -0,0 +1,194 @@
+package download
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ManifestEntry describes one file in a multi-file batch: where to fetch
+// it from, where to write it, and optionally the size/hash to check
+// before deciding whether it's already downloaded.
+type ManifestEntry struct {
+	URL    string `json:"url"`
+	Output string `json:"output"`
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+// BatchOptions configures a manifest-driven batch download. Options is
+// applied to every file's Downloader; MaxConcurrentFiles bounds how many
+// files download at once regardless of each file's own NumThreads.
+type BatchOptions struct {
+	Options
+	MaxConcurrentFiles uint
+	Mode               string // "segmented" or "stream"
+}
+
+type manifestProgress struct {
+	Completed map[string]manifestProgressEntry `json:"completed"`
+}
+
+type manifestProgressEntry struct {
+	URL    string `json:"url"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// DownloadManifest reads a JSON manifest of ManifestEntry objects and
+// downloads them concurrently, subject to opts.MaxConcurrentFiles. It
+// shares one http.Client and progress Pool across every file, skips
+// entries whose output already exists with matching size/hash, and writes
+// a manifest.progress.json sidecar recording finished entries so a killed
+// batch resumes without re-hashing files it already verified.
+func DownloadManifest(manifestPath string, opts BatchOptions) error {
+	switch opts.Mode {
+	case "", "segmented", "stream":
+	default:
+		return fmt.Errorf("unknown mode %q: must be \"segmented\" or \"stream\"", opts.Mode)
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var entries []ManifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	progressPath := manifestProgressPath(manifestPath)
+	progress := loadManifestProgress(progressPath)
+	var progressMu sync.Mutex
+
+	markComplete := func(entry ManifestEntry) {
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		progress.Completed[entry.Output] = manifestProgressEntry{URL: entry.URL, Size: entry.Size, SHA256: entry.SHA256}
+		saveManifestProgress(progressPath, progress)
+	}
+
+	pool := NewPool(opts.Quiet)
+	pool.Start()
+	defer pool.Stop()
+
+	limiter := NewFileLimiter(opts.MaxConcurrentFiles)
+	client := newHTTPClient()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(entries))
+
+	for i, entry := range entries {
+		i, entry := i, entry
+
+		if alreadyComplete(entry, progress) || matchesExisting(entry) {
+			if !opts.Quiet {
+				fmt.Printf("Skipping %s (already downloaded)\n", entry.Output)
+			}
+			markComplete(entry)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			limiter.Acquire()
+			defer limiter.Release()
+
+			fileOpts := opts.Options
+			fileOpts.Progress = pool.Sink(entry.Output)
+
+			var d Downloader
+			if opts.Mode == "stream" {
+				downloader := NewBufferedStreamMode(fileOpts)
+				downloader.client = client
+				d = downloader
+			} else {
+				downloader := NewSegmentedFileMode(fileOpts)
+				downloader.client = client
+				d = downloader
+			}
+
+			if err := d.Download([]string{entry.URL}, entry.Output); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", entry.Output, err)
+				return
+			}
+
+			markComplete(entry)
+		}()
+	}
+
+	wg.Wait()
+
+	var failures []string
+	for _, err := range errs {
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d files failed:\n%s", len(failures), len(entries), strings.Join(failures, "\n"))
+	}
+
+	return nil
+}
+
+func alreadyComplete(entry ManifestEntry, progress *manifestProgress) bool {
+	done, ok := progress.Completed[entry.Output]
+	return ok && done.URL == entry.URL && done.SHA256 == entry.SHA256 &&
+		(entry.Size == 0 || done.Size == entry.Size)
+}
+
+// matchesExisting reports whether entry.Output already exists on disk and
+// matches the size/hash the manifest promised. An entry with neither size
+// nor hash can't be trusted this way and is always (re)downloaded.
+func matchesExisting(entry ManifestEntry) bool {
+	if entry.Size == 0 && entry.SHA256 == "" {
+		return false
+	}
+
+	info, err := os.Stat(entry.Output)
+	if err != nil {
+		return false
+	}
+	if entry.Size > 0 && info.Size() != entry.Size {
+		return false
+	}
+	if entry.SHA256 != "" {
+		if err := verifyFileHash(entry.Output, "sha256", entry.SHA256); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func manifestProgressPath(manifestPath string) string {
+	base := strings.TrimSuffix(manifestPath, filepath.Ext(manifestPath))
+	return base + ".progress.json"
+}
+
+func loadManifestProgress(path string) *manifestProgress {
+	progress := &manifestProgress{Completed: make(map[string]manifestProgressEntry)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return progress
+	}
+	if err := json.Unmarshal(data, progress); err != nil || progress.Completed == nil {
+		progress.Completed = make(map[string]manifestProgressEntry)
+	}
+	return progress
+}
+
+func saveManifestProgress(path string, progress *manifestProgress) {
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return
+	}
+	os.WriteFile(path, data, 0666)
+}
@@ -0,0 +1,197 @@
+package download
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAlreadyComplete(t *testing.T) {
+	entry := ManifestEntry{URL: "http://example.com/f", Output: "f.bin", SHA256: "abc123", Size: 10}
+
+	cases := []struct {
+		name     string
+		progress *manifestProgress
+		want     bool
+	}{
+		{
+			name:     "not recorded",
+			progress: &manifestProgress{Completed: map[string]manifestProgressEntry{}},
+			want:     false,
+		},
+		{
+			name: "matches",
+			progress: &manifestProgress{Completed: map[string]manifestProgressEntry{
+				"f.bin": {URL: entry.URL, Size: entry.Size, SHA256: entry.SHA256},
+			}},
+			want: true,
+		},
+		{
+			name: "different url",
+			progress: &manifestProgress{Completed: map[string]manifestProgressEntry{
+				"f.bin": {URL: "http://example.com/other", Size: entry.Size, SHA256: entry.SHA256},
+			}},
+			want: false,
+		},
+		{
+			name: "different hash",
+			progress: &manifestProgress{Completed: map[string]manifestProgressEntry{
+				"f.bin": {URL: entry.URL, Size: entry.Size, SHA256: "different"},
+			}},
+			want: false,
+		},
+		{
+			name: "different size",
+			progress: &manifestProgress{Completed: map[string]manifestProgressEntry{
+				"f.bin": {URL: entry.URL, Size: 99, SHA256: entry.SHA256},
+			}},
+			want: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := alreadyComplete(entry, c.progress); got != c.want {
+				t.Fatalf("alreadyComplete() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestAlreadyCompleteIgnoresSizeWhenManifestOmitsIt(t *testing.T) {
+	entry := ManifestEntry{URL: "http://example.com/f", Output: "f.bin", SHA256: "abc123"}
+	progress := &manifestProgress{Completed: map[string]manifestProgressEntry{
+		"f.bin": {URL: entry.URL, Size: 12345, SHA256: entry.SHA256},
+	}}
+
+	if !alreadyComplete(entry, progress) {
+		t.Fatal("alreadyComplete() = false, want true when the manifest entry doesn't pin a size")
+	}
+}
+
+func TestMatchesExisting(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("hello, multidown")
+	path := filepath.Join(dir, "f.bin")
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	t.Run("no size or hash never trusts an existing file", func(t *testing.T) {
+		entry := ManifestEntry{Output: path}
+		if matchesExisting(entry) {
+			t.Fatal("matchesExisting() = true, want false with no size/hash to check")
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		entry := ManifestEntry{Output: filepath.Join(dir, "missing.bin"), Size: int64(len(data))}
+		if matchesExisting(entry) {
+			t.Fatal("matchesExisting() = true, want false for a file that doesn't exist")
+		}
+	})
+
+	t.Run("size mismatch", func(t *testing.T) {
+		entry := ManifestEntry{Output: path, Size: int64(len(data)) + 1}
+		if matchesExisting(entry) {
+			t.Fatal("matchesExisting() = true, want false on a size mismatch")
+		}
+	})
+
+	t.Run("size matches", func(t *testing.T) {
+		entry := ManifestEntry{Output: path, Size: int64(len(data))}
+		if !matchesExisting(entry) {
+			t.Fatal("matchesExisting() = false, want true when size matches and no hash is given")
+		}
+	})
+
+	t.Run("hash matches", func(t *testing.T) {
+		entry := ManifestEntry{Output: path, SHA256: sha256Hex(data)}
+		if !matchesExisting(entry) {
+			t.Fatal("matchesExisting() = false, want true when the sha256 matches")
+		}
+	})
+
+	t.Run("hash mismatch", func(t *testing.T) {
+		entry := ManifestEntry{Output: path, SHA256: sha256Hex([]byte("not the same data"))}
+		if matchesExisting(entry) {
+			t.Fatal("matchesExisting() = true, want false on a sha256 mismatch")
+		}
+	})
+}
+
+func TestManifestProgressPath(t *testing.T) {
+	cases := []struct {
+		manifestPath string
+		want         string
+	}{
+		{"manifest.json", "manifest.progress.json"},
+		{"/tmp/batch/manifest.json", "/tmp/batch/manifest.progress.json"},
+		{"manifest", "manifest.progress.json"},
+	}
+
+	for _, c := range cases {
+		if got := manifestProgressPath(c.manifestPath); got != c.want {
+			t.Errorf("manifestProgressPath(%q) = %q, want %q", c.manifestPath, got, c.want)
+		}
+	}
+}
+
+func TestLoadManifestProgressMissingFile(t *testing.T) {
+	progress := loadManifestProgress(filepath.Join(t.TempDir(), "nonexistent.progress.json"))
+	if progress.Completed == nil || len(progress.Completed) != 0 {
+		t.Fatalf("loadManifestProgress() = %+v, want an empty, non-nil Completed map", progress)
+	}
+}
+
+func TestLoadManifestProgressInvalidJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.progress.json")
+	if err := os.WriteFile(path, []byte("not json"), 0666); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	progress := loadManifestProgress(path)
+	if progress.Completed == nil || len(progress.Completed) != 0 {
+		t.Fatalf("loadManifestProgress() = %+v, want an empty, non-nil Completed map for invalid JSON", progress)
+	}
+}
+
+func TestSaveAndLoadManifestProgressRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.progress.json")
+	want := &manifestProgress{Completed: map[string]manifestProgressEntry{
+		"a.bin": {URL: "http://example.com/a", Size: 10, SHA256: "aaa"},
+		"b.bin": {URL: "http://example.com/b", Size: 20, SHA256: "bbb"},
+	}}
+
+	saveManifestProgress(path, want)
+	got := loadManifestProgress(path)
+
+	if len(got.Completed) != len(want.Completed) {
+		t.Fatalf("loadManifestProgress() = %+v, want %+v", got.Completed, want.Completed)
+	}
+	for output, entry := range want.Completed {
+		if got.Completed[output] != entry {
+			t.Errorf("loadManifestProgress()[%q] = %+v, want %+v", output, got.Completed[output], entry)
+		}
+	}
+}
+
+func TestDownloadManifestRejectsUnknownMode(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "manifest.json")
+	if err := os.WriteFile(manifestPath, []byte("[]"), 0666); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	err := DownloadManifest(manifestPath, BatchOptions{Mode: "strema"})
+	if err == nil {
+		t.Fatal("DownloadManifest() = nil error, want an error for an unknown mode")
+	}
+}
@@ -0,0 +1,129 @@
+package download
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// mirrorStat tracks one source URL's rolling throughput and recent error
+// history, so workers can prefer a healthy mirror and ride out a flapping
+// one with exponential backoff instead of failing the whole download.
+type mirrorStat struct {
+	mu             sync.Mutex
+	throughput     float64 // smoothed bytes/sec
+	errorStreak    int
+	backoff        time.Duration
+	penalizedUntil time.Time
+}
+
+func (s *mirrorStat) recordSuccess(bytes int64, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elapsed > 0 {
+		rate := float64(bytes) / elapsed.Seconds()
+		s.throughput = 0.7*s.throughput + 0.3*rate
+	}
+	s.errorStreak = 0
+	s.backoff = 0
+}
+
+const (
+	minMirrorBackoff = time.Second
+	maxMirrorBackoff = 2 * time.Minute
+)
+
+func (s *mirrorStat) recordFailure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errorStreak++
+	if s.backoff == 0 {
+		s.backoff = minMirrorBackoff
+	} else if s.backoff < maxMirrorBackoff {
+		s.backoff *= 2
+	}
+	s.penalizedUntil = time.Now().Add(s.backoff)
+}
+
+func (s *mirrorStat) snapshot() (available bool, errorStreak int, throughput float64, penalizedUntil time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !time.Now().Before(s.penalizedUntil), s.errorStreak, s.throughput, s.penalizedUntil
+}
+
+// mirrorSet is a group of equivalent source URLs a download may fetch
+// segments from, along with their rolling health stats.
+type mirrorSet struct {
+	urls  []string
+	stats []*mirrorStat
+}
+
+func newMirrorSet(urls []string) *mirrorSet {
+	stats := make([]*mirrorStat, len(urls))
+	for i := range stats {
+		stats[i] = &mirrorStat{}
+	}
+	return &mirrorSet{urls: urls, stats: stats}
+}
+
+// pick returns the index of the best available mirror -- the lowest
+// error-streak, highest-throughput one that isn't currently cooling down
+// -- or (-1, when) if every mirror is penalized, where when is the
+// earliest time one becomes available again.
+func (s *mirrorSet) pick() (index int, when time.Time) {
+	type candidate struct {
+		index      int
+		errorCount int
+		throughput float64
+	}
+
+	var best *candidate
+	var earliest time.Time
+
+	for i, stat := range s.stats {
+		available, errorStreak, throughput, penalizedUntil := stat.snapshot()
+		if !available {
+			if earliest.IsZero() || penalizedUntil.Before(earliest) {
+				earliest = penalizedUntil
+			}
+			continue
+		}
+
+		c := candidate{index: i, errorCount: errorStreak, throughput: throughput}
+		if best == nil || c.errorCount < best.errorCount ||
+			(c.errorCount == best.errorCount && c.throughput > best.throughput) {
+			best = &c
+		}
+	}
+
+	if best == nil {
+		return -1, earliest
+	}
+	return best.index, time.Time{}
+}
+
+// verifyMirrorsAgree HEADs every mirror beyond the first and refuses the
+// set if any of them disagree with the primary on content length or (when
+// both advertise one of the same kind) content hash.
+func verifyMirrorsAgree(client *http.Client, urls []string, length int64, primaryHeader http.Header) error {
+	primaryAlgo, primaryHash := extractContentHash(primaryHeader)
+
+	for _, url := range urls[1:] {
+		mirrorLength, header, err := headRequest(client, url)
+		if err != nil {
+			return fmt.Errorf("mirror %s: %w", url, err)
+		}
+		if mirrorLength != length {
+			return fmt.Errorf("mirror %s reports a different length (%d vs %d)", url, mirrorLength, length)
+		}
+
+		if primaryAlgo != "" {
+			if algo, hash := extractContentHash(header); algo == primaryAlgo && hash != primaryHash {
+				return fmt.Errorf("mirror %s reports a different %s hash than the primary source", url, algo)
+			}
+		}
+	}
+
+	return nil
+}
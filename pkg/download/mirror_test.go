@@ -0,0 +1,77 @@
+package download
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMirrorSetPickPrefersHigherThroughput(t *testing.T) {
+	s := newMirrorSet([]string{"a", "b"})
+	s.stats[0].recordSuccess(1000, time.Second) // 1000 B/s
+	s.stats[1].recordSuccess(2000, time.Second) // 2000 B/s
+
+	index, _ := s.pick()
+	if index != 1 {
+		t.Fatalf("pick() = %d, want 1 (the higher-throughput mirror)", index)
+	}
+}
+
+func TestMirrorSetPickPrefersLowerErrorStreakOverThroughput(t *testing.T) {
+	s := newMirrorSet([]string{"a", "b"})
+	s.stats[0].recordSuccess(2000, time.Second)
+	s.stats[1].recordSuccess(1000, time.Second)
+	// Give mirror 1 an error streak, then let its penalty window lapse so
+	// it's pickable again but still remembered as less reliable.
+	s.stats[1].recordFailure()
+	s.stats[1].penalizedUntil = time.Now().Add(-time.Millisecond)
+
+	index, _ := s.pick()
+	if index != 0 {
+		t.Fatalf("pick() = %d, want 0 (the mirror with no error streak)", index)
+	}
+}
+
+func TestMirrorSetPickSkipsPenalizedMirrors(t *testing.T) {
+	s := newMirrorSet([]string{"a", "b"})
+	s.stats[0].recordFailure()
+
+	index, _ := s.pick()
+	if index != 1 {
+		t.Fatalf("pick() = %d, want 1 (the only non-penalized mirror)", index)
+	}
+}
+
+func TestMirrorSetPickReturnsNegativeWhenAllPenalized(t *testing.T) {
+	s := newMirrorSet([]string{"a", "b"})
+	s.stats[0].recordFailure()
+	s.stats[1].recordFailure()
+
+	index, when := s.pick()
+	if index != -1 {
+		t.Fatalf("pick() index = %d, want -1 when every mirror is penalized", index)
+	}
+	if !when.After(time.Now()) {
+		t.Fatalf("pick() when = %v, want a time in the future", when)
+	}
+}
+
+func TestMirrorStatBackoffGrowsExponentiallyOnRepeatedFailure(t *testing.T) {
+	s := &mirrorStat{}
+
+	s.recordFailure()
+	first := s.backoff
+	if first != minMirrorBackoff {
+		t.Fatalf("backoff after first failure = %v, want %v", first, minMirrorBackoff)
+	}
+
+	s.recordFailure()
+	second := s.backoff
+	if second <= first {
+		t.Fatalf("backoff after second failure = %v, want it to grow past %v", second, first)
+	}
+
+	s.recordSuccess(1, time.Second)
+	if s.backoff != 0 || s.errorStreak != 0 {
+		t.Fatalf("recordSuccess did not reset backoff/errorStreak: backoff=%v errorStreak=%d", s.backoff, s.errorStreak)
+	}
+}
@@ -0,0 +1,139 @@
+package download
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type poolFile struct {
+	downloaded int64
+	total      int64
+	finished   bool
+}
+
+// Pool renders one progress bar per file for a batch of concurrent
+// downloads sharing a single render loop, rather than each Downloader
+// drawing its own per-worker bars. A manifest batch creates one Pool and
+// hands each file's Downloader a Sink to report into.
+type Pool struct {
+	mu    sync.Mutex
+	order []string
+	files map[string]*poolFile
+	quiet bool
+
+	lastLine time.Time
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// NewPool returns a Pool. quiet suppresses all output, matching -q.
+func NewPool(quiet bool) *Pool {
+	return &Pool{files: make(map[string]*poolFile), quiet: quiet}
+}
+
+// Sink returns a ProgressSink reporting name's progress into the pool,
+// registering name as a new row if this is its first report.
+func (p *Pool) Sink(name string) ProgressSink {
+	p.mu.Lock()
+	if _, ok := p.files[name]; !ok {
+		p.files[name] = &poolFile{}
+		p.order = append(p.order, name)
+	}
+	p.mu.Unlock()
+
+	return func(downloaded, total int64, finished bool) {
+		p.mu.Lock()
+		f := p.files[name]
+		f.downloaded = downloaded
+		f.total = total
+		f.finished = finished
+		p.mu.Unlock()
+	}
+}
+
+// Start begins the shared render loop. Call once before any files start
+// reporting progress.
+func (p *Pool) Start() {
+	if p.quiet {
+		return
+	}
+	p.stop = make(chan struct{})
+	p.stopped = make(chan struct{})
+
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(200 * time.Millisecond)
+		defer ticker.Stop()
+		lines := 0
+		for {
+			select {
+			case <-ticker.C:
+				lines = p.render(lines, false)
+			case <-p.stop:
+				p.render(lines, true)
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the render loop and prints a final frame.
+func (p *Pool) Stop() {
+	if p.quiet || p.stop == nil {
+		return
+	}
+	close(p.stop)
+	<-p.stopped
+}
+
+func (p *Pool) render(prevLines int, final bool) int {
+	p.mu.Lock()
+	names := append([]string(nil), p.order...)
+	snapshot := make(map[string]poolFile, len(names))
+	for _, name := range names {
+		snapshot[name] = *p.files[name]
+	}
+	p.mu.Unlock()
+
+	interactive := isTerminal(os.Stdout)
+
+	if interactive {
+		if prevLines > 0 {
+			fmt.Printf("\x1b[%dF", prevLines)
+		}
+		for _, name := range names {
+			f := snapshot[name]
+			fraction := 0.0
+			if f.total > 0 {
+				fraction = float64(f.downloaded) / float64(f.total)
+			}
+			status := "... "
+			if f.finished {
+				status = "done"
+			}
+			fmt.Printf("\x1b[K%s %s %10s / %-10s  %s\n",
+				status, renderBar(fraction, 20), formatBytes(f.downloaded), formatBytes(f.total), name)
+		}
+		return len(names)
+	}
+
+	if !final && time.Since(p.lastLine) < time.Second {
+		return 0
+	}
+	p.lastLine = time.Now()
+
+	var downloaded, total int64
+	var finishedCount int
+	for _, name := range names {
+		f := snapshot[name]
+		downloaded += f.downloaded
+		total += f.total
+		if f.finished {
+			finishedCount++
+		}
+	}
+	fmt.Printf("%d/%d files done, %s / %s\n", finishedCount, len(names), formatBytes(downloaded), formatBytes(total))
+	return 0
+}
@@ -0,0 +1,226 @@
+package download
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// progressUpdate reports a worker's byte position within its current
+// segment (or buffer, for BufferedStreamMode).
+type progressUpdate struct {
+	threadnum   uint
+	downloaded  int64
+	segmentSize int64
+}
+
+// segmentComplete reports that a worker has fully finished a unit of work,
+// so its bytes should move from "in flight" to "done" in the total. Using
+// a dedicated event (rather than inferring completion from progressUpdate)
+// means a segment's bytes are counted exactly once even across retries.
+type segmentComplete struct {
+	threadnum uint
+	bytes     int64
+}
+
+// threadProgress tracks one worker's position within its current segment,
+// along with enough history to report an exponentially-smoothed speed.
+type threadProgress struct {
+	current     int64
+	segmentSize int64
+	speed       float64
+	lastSample  time.Time
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024.0
+	value := float64(n)
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	for _, u := range units {
+		if value < unit {
+			if u == "B" {
+				return fmt.Sprintf("%.0f%s", value, u)
+			}
+			return fmt.Sprintf("%.2f%s", value, u)
+		}
+		value /= unit
+	}
+	return fmt.Sprintf("%.2fPiB", value)
+}
+
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		return "--:--"
+	}
+	seconds := int64(d.Seconds())
+	hours, seconds := seconds/3600, seconds%3600
+	minutes, seconds := seconds/60, seconds%60
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%02d:%02d", minutes, seconds)
+}
+
+func renderBar(fraction float64, width int) string {
+	if fraction < 0 {
+		fraction = 0
+	} else if fraction > 1 {
+		fraction = 1
+	}
+	filled := int(fraction * float64(width))
+	return "[" + strings.Repeat("=", filled) + strings.Repeat("-", width-filled) + "]"
+}
+
+// ProgressSink receives periodic whole-file progress samples: downloaded
+// and total bytes so far, and whether the file is finished. It's the hook
+// a multi-file batch uses to drive one shared bar per file (see Pool)
+// instead of each Downloader drawing its own per-worker bars.
+type ProgressSink func(downloaded, total int64, finished bool)
+
+// runAggregate reconciles updates/completions the same way printProgress
+// does, but reports the resulting whole-file total to sink instead of
+// drawing anything itself.
+func runAggregate(updates chan progressUpdate, completions chan segmentComplete, done chan struct{},
+	totalLength int64, numThreads uint, sink ProgressSink) {
+
+	threadBytes := make([]int64, numThreads)
+	var completedBytes int64
+
+	report := func(finished bool) {
+		live := int64(0)
+		for _, b := range threadBytes {
+			live += b
+		}
+		sink(completedBytes+live, totalLength, finished)
+	}
+
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case u := <-updates:
+			threadBytes[u.threadnum] = u.downloaded
+
+		case c := <-completions:
+			completedBytes += c.bytes
+			threadBytes[c.threadnum] = 0
+
+		case <-ticker.C:
+			report(false)
+
+		case <-done:
+			report(true)
+			return
+		}
+	}
+}
+
+// printProgress renders a bar per worker plus a total bar summarizing
+// overall progress, reading live per-thread byte counts off updates and
+// reconciling them against completions so a segment's bytes are counted
+// exactly once, even across retries. On a non-TTY stdout it falls back to
+// a periodic single-line summary; Quiet keeps full silence.
+func printProgress(updates chan progressUpdate, completions chan segmentComplete, done chan struct{},
+	totalLength int64, numThreads uint, quiet bool) {
+
+	if quiet {
+		for {
+			select {
+			case <-updates:
+			case <-completions:
+			case <-done:
+				return
+			}
+		}
+	}
+
+	interactive := isTerminal(os.Stdout)
+	threads := make([]threadProgress, numThreads)
+	startTime := time.Now()
+	now := startTime
+	for i := range threads {
+		threads[i].lastSample = now
+	}
+	var completedBytes int64
+	var lastLine time.Time
+
+	render := func(final bool) {
+		liveBytes := int64(0)
+		for i := range threads {
+			liveBytes += threads[i].current
+		}
+		downloaded := completedBytes + liveBytes
+		elapsed := time.Since(startTime).Seconds()
+		speed := 0.0
+		if elapsed > 0 {
+			speed = float64(downloaded) / elapsed
+		}
+
+		overallFraction := 0.0
+		if totalLength > 0 {
+			overallFraction = float64(downloaded) / float64(totalLength)
+		}
+
+		if interactive {
+			fmt.Printf("\x1b[%dF", numThreads+1)
+			for i := range threads {
+				fraction := 0.0
+				if threads[i].segmentSize > 0 {
+					fraction = float64(threads[i].current) / float64(threads[i].segmentSize)
+				}
+				fmt.Printf("\x1b[Kworker %-2d %s %10s  %10s/s\n",
+					i, renderBar(fraction, 20), formatBytes(threads[i].current), formatBytes(int64(threads[i].speed)))
+			}
+			eta := "--:--"
+			if speed > 0 && totalLength > downloaded {
+				eta = formatDuration(time.Duration(float64(totalLength-downloaded) / speed * float64(time.Second)))
+			}
+			fmt.Printf("\x1b[Ktotal      %s %10s / %-10s  %10s/s  ETA %s\n",
+				renderBar(overallFraction, 20), formatBytes(downloaded), formatBytes(totalLength),
+				formatBytes(int64(speed)), eta)
+		} else if final || time.Since(lastLine) >= time.Second {
+			fmt.Printf("%6.1f%%  %10s / %-10s  %10s/s\n",
+				overallFraction*100, formatBytes(downloaded), formatBytes(totalLength), formatBytes(int64(speed)))
+			lastLine = time.Now()
+		}
+	}
+
+	if interactive {
+		fmt.Print(strings.Repeat("\n", int(numThreads)+1))
+	}
+
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case update := <-updates:
+			t := &threads[update.threadnum]
+			if elapsed := time.Since(t.lastSample).Seconds(); elapsed > 0 {
+				t.speed = 0.7*t.speed + 0.3*(float64(update.downloaded-t.current)/elapsed)
+			}
+			t.current = update.downloaded
+			t.segmentSize = update.segmentSize
+			t.lastSample = time.Now()
+
+		case completion := <-completions:
+			completedBytes += completion.bytes
+			threads[completion.threadnum].current = 0
+			threads[completion.threadnum].segmentSize = 0
+
+		case <-ticker.C:
+			render(false)
+
+		case <-done:
+			render(true)
+			return
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/time/rate"
+)
+
+// ParseByteRate parses a bytefmt-style rate like "500k", "2M", or "1G" (also
+// accepting a bare byte count) into a bytes-per-second figure suitable for
+// NewRateLimiter. Suffixes are binary: k=1024, M=1024^2, G=1024^3.
+func ParseByteRate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty rate")
+	}
+
+	multiplier := int64(1)
+	switch suffix := s[len(s)-1]; suffix {
+	case 'k', 'K':
+		multiplier = 1024
+		s = s[:len(s)-1]
+	case 'm', 'M':
+		multiplier = 1024 * 1024
+		s = s[:len(s)-1]
+	case 'g', 'G':
+		multiplier = 1024 * 1024 * 1024
+		s = s[:len(s)-1]
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q: %w", s, err)
+	}
+	if value <= 0 {
+		return 0, fmt.Errorf("invalid rate %q: must be positive", s)
+	}
+
+	return int64(value * float64(multiplier)), nil
+}
+
+// NewRateLimiter returns a token-bucket limiter capping egress at
+// bytesPerSecond, shared across every worker of a download so the whole
+// transfer -- not each connection individually -- respects the cap.
+func NewRateLimiter(bytesPerSecond int64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(bytesPerSecond))
+}
+
+// rateLimitedReader throttles Read to at most limiter's configured rate by
+// waiting for tokens after each read, regardless of how small limiter's
+// burst is relative to the caller's buffer size.
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := waitRateLimit(r.limiter, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// waitRateLimit blocks until limiter has released n tokens, reserving them
+// in limiter.Burst()-sized pieces since WaitN rejects requests larger than
+// the burst.
+func waitRateLimit(limiter *rate.Limiter, n int) error {
+	if limiter == nil || n <= 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	burst := limiter.Burst()
+	for n > 0 {
+		take := n
+		if take > burst {
+			take = burst
+		}
+		if err := limiter.WaitN(ctx, take); err != nil {
+			return err
+		}
+		n -= take
+	}
+	return nil
+}
+
+// limitReader wraps r so reads are throttled by limiter, or returns r
+// unchanged if limiter is nil.
+func limitReader(r io.Reader, limiter *rate.Limiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &rateLimitedReader{r: r, limiter: limiter}
+}
@@ -0,0 +1,42 @@
+package download
+
+import "testing"
+
+func TestParseByteRate(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{name: "bare bytes", input: "1024", want: 1024},
+		{name: "kilobytes", input: "500k", want: 500 * 1024},
+		{name: "kilobytes uppercase", input: "500K", want: 500 * 1024},
+		{name: "megabytes", input: "2M", want: 2 * 1024 * 1024},
+		{name: "gigabytes", input: "1G", want: 1024 * 1024 * 1024},
+		{name: "fractional with suffix", input: "1.5M", want: int64(1.5 * 1024 * 1024)},
+		{name: "whitespace is trimmed", input: "  2M  ", want: 2 * 1024 * 1024},
+		{name: "empty", input: "", wantErr: true},
+		{name: "not a number", input: "abc", wantErr: true},
+		{name: "zero", input: "0", wantErr: true},
+		{name: "negative", input: "-5M", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseByteRate(c.input)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("ParseByteRate(%q) = %d, nil; want an error", c.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseByteRate(%q) returned unexpected error: %v", c.input, err)
+			}
+			if got != c.want {
+				t.Fatalf("ParseByteRate(%q) = %d, want %d", c.input, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package download
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+const maxConsecutiveMirrorFailures = 20
+
+// segmentJob is one worker's assignment: fetch size bytes starting at
+// position, and mark segmentCount consecutive progress-file segments
+// starting at segmentStart finished once done. A job spans more than one
+// grid segment when adaptive sizing has grown the dispatched range beyond
+// the progress file's resume granularity.
+type segmentJob struct {
+	position     int64
+	size         int64
+	segmentStart int
+	segmentCount int
+}
+
+// SegmentedFileMode is the original multidown download strategy: the
+// output file is preallocated and each worker writes its assigned range
+// directly to the matching offset, so the download can resume from a
+// .multidownload sidecar after being interrupted.
+type SegmentedFileMode struct {
+	Options
+
+	client *http.Client
+}
+
+// NewSegmentedFileMode returns a SegmentedFileMode Downloader.
+func NewSegmentedFileMode(opts Options) *SegmentedFileMode {
+	return &SegmentedFileMode{Options: opts, client: newHTTPClient()}
+}
+
+func (m *SegmentedFileMode) Download(urls []string, filename string) error {
+	length, headers, err := headRequest(m.client, urls[0])
+	if err != nil {
+		return err
+	}
+
+	if len(urls) > 1 {
+		if err := verifyMirrorsAgree(m.client, urls, length, headers); err != nil {
+			return fmt.Errorf("mirrors disagree: %w", err)
+		}
+	}
+	mirrors := newMirrorSet(urls)
+
+	hashAlgorithm, expectedHash := "", ""
+	if m.Verify {
+		hashAlgorithm, expectedHash = extractContentHash(headers)
+	}
+
+	progressFilename := fmt.Sprintf("%s.multidownload", filename)
+	success := false
+	defer func() {
+		if success {
+			os.Remove(progressFilename)
+		}
+	}()
+	if !m.Quiet {
+		fmt.Printf("Download file %.2fMB\n", float64(length)/1e6)
+	}
+
+	fileinfo, statErr := os.Stat(filename)
+	if _, progerr := os.Stat(progressFilename); statErr == nil && fileinfo.Size() == length && progerr != nil {
+		if !m.Quiet {
+			fmt.Println("File already downloaded")
+		}
+		success = true
+		return nil
+	}
+
+	segmentSize := m.SegmentSize
+	adaptive := segmentSize <= 0
+	var initialDispatchSize int64
+	if adaptive {
+		initialDispatchSize = chooseSegmentSize(m.client, urls[0], length)
+		// The progress file's own grid uses the smallest practical cell
+		// size rather than the throughput-probed size above: that keeps
+		// resume granularity fine enough that adaptiveSegmentSizer can
+		// actually shrink a job back down to a single grid cell later, not
+		// just grow a batch up from whatever the initial probe guessed.
+		segmentSize = gridSegmentSize(length)
+	}
+
+	progressFile, info, truncate, err := setupProgressFile(progressFilename, length, segmentSize, hashAlgorithm, expectedHash, statErr != nil, m.Quiet)
+	if err != nil {
+		return fmt.Errorf("failed to setup progress file: %w", err)
+	}
+	defer progressFile.Close()
+
+	if !m.Verify {
+		// A resumed progress file may carry a hash captured by an earlier,
+		// verify-enabled run; don't let it linger once this run has asked
+		// not to verify.
+		info.HashAlgorithm, info.ExpectedHash = "", ""
+	}
+
+	// O_APPEND is deliberately not set: workers write at their assigned
+	// offset via WriteAt, which Go refuses outright on an append-mode file.
+	outopts := os.O_RDWR | os.O_CREATE
+	if truncate {
+		outopts |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(filename, outopts, 0666)
+	if err != nil {
+		return fmt.Errorf("unable to open output file: %w", err)
+	}
+	defer file.Close()
+
+	instructions := make(chan segmentJob)
+	updates := make(chan progressUpdate)
+	completions := make(chan segmentComplete, m.NumThreads)
+	workerErrs := make(chan error, m.NumThreads)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	renderDone := make(chan struct{})
+	sem := newSemaphore(m.maxConcurrency())
+
+	// sizer re-sizes the range dispatched per job from the throughput
+	// actually observed on the transfer, rather than freezing in
+	// chooseSegmentSize's one-shot probe for the whole file. It's nil (and
+	// every job spans exactly one grid segment) when the caller pinned an
+	// explicit SegmentSize, so that setting still means what it says.
+	var sizer *adaptiveSegmentSizer
+	if adaptive {
+		sizer = newAdaptiveSegmentSizer(initialDispatchSize)
+	}
+
+	for i := uint(0); i < m.NumThreads; i++ {
+		go m.downloadSegments(i, mirrors, instructions, updates, completions, workerErrs, stop, sem, file, progressFile, sizer)
+	}
+
+	go func() {
+		if m.Progress != nil {
+			runAggregate(updates, completions, done, info.Length, m.NumThreads, m.Progress)
+		} else {
+			printProgress(updates, completions, done, info.Length, m.NumThreads, m.Quiet)
+		}
+		close(renderDone)
+	}()
+
+	var downloadErr error
+dispatch:
+	for seg := 0; seg < len(info.segments); {
+		if info.segments[seg] {
+			seg++
+			continue
+		}
+
+		count := 1
+		if sizer != nil {
+			if c := int(sizer.next() / info.SegmentSize); c > count {
+				count = c
+			}
+		}
+		if seg+count > len(info.segments) {
+			count = len(info.segments) - seg
+		}
+		for c := 1; c < count; c++ {
+			if info.segments[seg+c] {
+				count = c
+				break
+			}
+		}
+
+		pos := int64(seg) * info.SegmentSize
+		end := int64(seg+count) * info.SegmentSize
+		if end > info.Length {
+			end = info.Length
+		}
+
+		select {
+		case instructions <- segmentJob{position: pos, size: end - pos, segmentStart: seg, segmentCount: count}:
+		case downloadErr = <-workerErrs:
+			break dispatch
+		}
+
+		seg += count
+	}
+
+	for i := uint(0); downloadErr == nil && i < m.NumThreads; i++ {
+		select {
+		case instructions <- segmentJob{position: info.Length, size: 0}:
+		case downloadErr = <-workerErrs:
+		}
+	}
+
+	close(stop)
+	close(done)
+	<-renderDone
+
+	if downloadErr != nil {
+		return downloadErr
+	}
+
+	if info.HashAlgorithm != "" {
+		if !m.Quiet {
+			fmt.Printf("Verifying %s checksum\n", info.HashAlgorithm)
+		}
+		if err := verifyFileHash(filename, info.HashAlgorithm, info.ExpectedHash); err != nil {
+			return fmt.Errorf("content verification failed: %w", err)
+		}
+	}
+
+	success = true
+	return nil
+}
+
+func (m *SegmentedFileMode) downloadSegments(threadnum uint, mirrors *mirrorSet, instructions chan segmentJob, updates chan progressUpdate,
+	completions chan segmentComplete, errs chan error, stop chan struct{}, sem semaphore, file *os.File, progressFile *os.File, sizer *adaptiveSegmentSizer) {
+
+	finished := true
+	buf := make([]byte, 8192)
+	segmentTotal := int64(0)
+	progress := int64(0)
+	errorCount := int64(0)
+
+	reportErr := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+
+	var down segmentJob
+	for {
+		if finished {
+			select {
+			case down = <-instructions:
+			case <-stop:
+				return
+			}
+			if down.size == 0 {
+				break
+			}
+			finished = false
+			segmentTotal = down.size
+			progress = 0
+		}
+
+		mirrorIndex, when := mirrors.pick()
+		if mirrorIndex == -1 {
+			time.Sleep(time.Until(when))
+			continue
+		}
+
+		req, err := http.NewRequest("GET", mirrors.urls[mirrorIndex], nil)
+		if err != nil {
+			reportErr(fmt.Errorf("failed to create request: %w", err))
+			return
+		}
+
+		req.Header.Add("Range", fmt.Sprintf("bytes=%d-%d", down.position, down.position+down.size-1))
+
+		start := time.Now()
+		sem.acquire()
+		resp, err := m.client.Do(req)
+		sem.release()
+		if err != nil || (resp.StatusCode != 206 && resp.StatusCode != 200) {
+			errorCount++
+			mirrors.stats[mirrorIndex].recordFailure()
+			if errorCount > maxConsecutiveMirrorFailures {
+				reportErr(fmt.Errorf("failed to run GET too many times across all mirrors for segment %d. Check network connection?", down.segmentStart))
+				return
+			} else {
+				continue
+			}
+		}
+
+		errorCount = 0
+
+		read := int64(0)
+		body := limitReader(resp.Body, m.RateLimiter)
+
+		for read < down.size {
+			n, err := body.Read(buf[:])
+			if n == 0 && err != nil {
+				break
+			}
+
+			file.WriteAt(buf[:n], down.position+read)
+			read += int64(n)
+			progress += int64(n)
+			updates <- progressUpdate{threadnum: threadnum, downloaded: progress, segmentSize: segmentTotal}
+		}
+
+		if read >= down.size {
+			finished = true
+			elapsed := time.Since(start)
+			mirrors.stats[mirrorIndex].recordSuccess(read, elapsed)
+			if sizer != nil {
+				sizer.record(read, elapsed)
+			}
+			markSegmentsFinished(progressFile, down.segmentStart, down.segmentCount)
+			completions <- segmentComplete{threadnum: threadnum, bytes: segmentTotal}
+		} else {
+			mirrors.stats[mirrorIndex].recordFailure()
+			if sizer != nil {
+				sizer.shrink()
+			}
+			down.position += read
+			down.size -= read
+		}
+	}
+}
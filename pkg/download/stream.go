@@ -0,0 +1,283 @@
+package download
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// bufferedReader is an io.Reader backed by an in-memory buffer that isn't
+// readable until fill is called; Read blocks until then. This lets a
+// worker populate a chunk out of order while chanMultiReader reads chunks
+// back in file order.
+type bufferedReader struct {
+	buf  bytes.Buffer
+	err  error
+	done chan struct{}
+}
+
+func newBufferedReader() *bufferedReader {
+	return &bufferedReader{done: make(chan struct{})}
+}
+
+// fill populates the buffer and unblocks any pending or future Read. It
+// must be called exactly once.
+func (b *bufferedReader) fill(data []byte, err error) {
+	b.buf.Write(data)
+	b.err = err
+	close(b.done)
+}
+
+func (b *bufferedReader) Read(p []byte) (int, error) {
+	<-b.done
+	if b.buf.Len() == 0 && b.err != nil {
+		return 0, b.err
+	}
+	return b.buf.Read(p)
+}
+
+// chanMultiReader concatenates a fixed sequence of readers in order. Unlike
+// io.MultiReader, the readers need not be ready up front: Read on the
+// current reader simply blocks (via bufferedReader) until its chunk has
+// arrived, so out-of-order completion downstream doesn't reorder bytes.
+type chanMultiReader struct {
+	readers []io.Reader
+	index   int
+}
+
+func newChanMultiReader(readers []io.Reader) *chanMultiReader {
+	return &chanMultiReader{readers: readers}
+}
+
+func (m *chanMultiReader) Read(p []byte) (int, error) {
+	for m.index < len(m.readers) {
+		n, err := m.readers[m.index].Read(p)
+		if n > 0 || err == nil {
+			return n, nil
+		}
+		if err != io.EOF {
+			return n, err
+		}
+		m.index++
+	}
+	return 0, io.EOF
+}
+
+// BufferedStreamMode fetches a URL's segments into per-segment in-memory
+// buffers and exposes the whole file as a single ordered io.Reader, so a
+// caller can start consuming output (piping to stdout, feeding a decoder)
+// before the tail segments have finished fetching.
+type BufferedStreamMode struct {
+	Options
+
+	client *http.Client
+}
+
+// NewBufferedStreamMode returns a BufferedStreamMode Downloader.
+func NewBufferedStreamMode(opts Options) *BufferedStreamMode {
+	return &BufferedStreamMode{Options: opts, client: newHTTPClient()}
+}
+
+type streamSession struct {
+	reader        io.Reader
+	length        int64
+	hashAlgorithm string
+	expectedHash  string
+}
+
+func (m *BufferedStreamMode) start(urls []string) (*streamSession, error) {
+	length, headers, err := headRequest(m.client, urls[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(urls) > 1 {
+		if err := verifyMirrorsAgree(m.client, urls, length, headers); err != nil {
+			return nil, fmt.Errorf("mirrors disagree: %w", err)
+		}
+	}
+	mirrors := newMirrorSet(urls)
+
+	hashAlgorithm, expectedHash := "", ""
+	if m.Verify {
+		hashAlgorithm, expectedHash = extractContentHash(headers)
+	}
+
+	segmentSize := m.SegmentSize
+	if segmentSize <= 0 {
+		segmentSize = chooseSegmentSize(m.client, urls[0], length)
+	}
+
+	segmentCount := int(findSegmentCount(length, segmentSize))
+	buffers := make([]*bufferedReader, segmentCount)
+	readers := make([]io.Reader, segmentCount)
+	for i := range buffers {
+		buffers[i] = newBufferedReader()
+		readers[i] = buffers[i]
+	}
+
+	jobs := make(chan int, segmentCount)
+	for i := 0; i < segmentCount; i++ {
+		jobs <- i
+	}
+	close(jobs)
+
+	updates := make(chan progressUpdate)
+	completions := make(chan segmentComplete, m.NumThreads)
+	done := make(chan struct{})
+	sem := newSemaphore(m.maxConcurrency())
+
+	var wg sync.WaitGroup
+	for i := uint(0); i < m.NumThreads; i++ {
+		wg.Add(1)
+		go m.fetchSegments(i, mirrors, length, segmentSize, jobs, buffers, updates, completions, sem, &wg)
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	go func() {
+		if m.Progress != nil {
+			runAggregate(updates, completions, done, length, m.NumThreads, m.Progress)
+		} else {
+			printProgress(updates, completions, done, length, m.NumThreads, m.Quiet)
+		}
+	}()
+
+	return &streamSession{
+		reader:        newChanMultiReader(readers),
+		length:        length,
+		hashAlgorithm: hashAlgorithm,
+		expectedHash:  expectedHash,
+	}, nil
+}
+
+// Reader begins fetching url across m.NumThreads workers and returns an
+// io.Reader yielding the file's bytes in order, along with its total
+// length. The tail of the file may still be in flight when Reader
+// returns.
+func (m *BufferedStreamMode) Reader(urls []string) (io.Reader, int64, error) {
+	session, err := m.start(urls)
+	if err != nil {
+		return nil, 0, err
+	}
+	return session.reader, session.length, nil
+}
+
+func (m *BufferedStreamMode) Download(urls []string, filename string) error {
+	session, err := m.start(urls)
+	if err != nil {
+		return err
+	}
+
+	if !m.Quiet {
+		fmt.Printf("Download file %.2fMB\n", float64(session.length)/1e6)
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("unable to open output file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, session.reader); err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+
+	if session.hashAlgorithm != "" {
+		if !m.Quiet {
+			fmt.Printf("Verifying %s checksum\n", session.hashAlgorithm)
+		}
+		if err := verifyFileHash(filename, session.hashAlgorithm, session.expectedHash); err != nil {
+			return fmt.Errorf("content verification failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (m *BufferedStreamMode) fetchSegments(threadnum uint, mirrors *mirrorSet, length, segmentSize int64, jobs <-chan int, buffers []*bufferedReader,
+	updates chan progressUpdate, completions chan segmentComplete, sem semaphore, wg *sync.WaitGroup) {
+
+	defer wg.Done()
+
+	for segIdx := range jobs {
+		pos := int64(segIdx) * segmentSize
+		size := segmentSize
+		if pos+size > length {
+			size = length - pos
+		}
+
+		data, err := m.fetchRange(mirrors, pos, size, threadnum, updates, sem)
+		if err != nil {
+			buffers[segIdx].fill(nil, fmt.Errorf("failed to fetch segment: %w", err))
+			return
+		}
+
+		buffers[segIdx].fill(data, nil)
+		completions <- segmentComplete{threadnum: threadnum, bytes: size}
+	}
+}
+
+// fetchRange fetches pos-size from mirrors, picking the healthiest mirror
+// (by rolling throughput/error rate) for each attempt the same way
+// SegmentedFileMode.downloadSegments does, so a flapping mirror in stream
+// mode gets the same exponential-backoff penalty instead of a bare
+// round-robin retry.
+func (m *BufferedStreamMode) fetchRange(mirrors *mirrorSet, pos, size int64, threadnum uint, updates chan progressUpdate, sem semaphore) ([]byte, error) {
+	errorCount := 0
+	for {
+		mirrorIndex, when := mirrors.pick()
+		if mirrorIndex == -1 {
+			time.Sleep(time.Until(when))
+			continue
+		}
+
+		req, err := http.NewRequest("GET", mirrors.urls[mirrorIndex], nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Range", fmt.Sprintf("bytes=%d-%d", pos, pos+size-1))
+
+		start := time.Now()
+		sem.acquire()
+		resp, err := m.client.Do(req)
+		sem.release()
+		if err != nil || (resp.StatusCode != 206 && resp.StatusCode != 200) {
+			errorCount++
+			mirrors.stats[mirrorIndex].recordFailure()
+			if errorCount > maxConsecutiveMirrorFailures {
+				return nil, fmt.Errorf("failed to run GET too many times across all mirrors for range %d-%d", pos, pos+size-1)
+			}
+			continue
+		}
+
+		buf := make([]byte, size)
+		read := int64(0)
+		body := limitReader(resp.Body, m.RateLimiter)
+		for read < size {
+			n, err := body.Read(buf[read:])
+			read += int64(n)
+			updates <- progressUpdate{threadnum: threadnum, downloaded: read, segmentSize: size}
+			if n == 0 && err != nil {
+				break
+			}
+		}
+
+		if read >= size {
+			mirrors.stats[mirrorIndex].recordSuccess(read, time.Since(start))
+			return buf, nil
+		}
+
+		mirrors.stats[mirrorIndex].recordFailure()
+		errorCount++
+		if errorCount > maxConsecutiveMirrorFailures {
+			return nil, fmt.Errorf("too many short reads for range %d-%d", pos, pos+size-1)
+		}
+	}
+}